@@ -0,0 +1,133 @@
+#!/bin/bash
+
+# Script to periodically back up Consul (and optionally Vault) to MinIO, encrypted and with retention
+# Usage: ./backup-to-minio.sh
+
+CONSUL_ADDR=${CONSUL_HTTP_ADDR:-http://consul-server:8500}
+MINIO_ADDR=${BACKUP_MINIO_ENDPOINT:-http://minio:9000}
+BUCKET=${BACKUP_BUCKET:-backups}
+INTERVAL=${BACKUP_INTERVAL_SECONDS:-86400}
+RETENTION_DAYS=${BACKUP_RETENTION_DAYS:-7}
+KEEP_MIN=${BACKUP_KEEP_MIN:-3}
+WORK_DIR=/tmp/backups
+
+if [ -z "$BACKUP_ENCRYPTION_KEY" ] || [[ "$BACKUP_ENCRYPTION_KEY" == change-me* ]]; then
+  echo "BACKUP_ENCRYPTION_KEY must be set to a secret value"
+  exit 1
+fi
+
+# Signed S3 request against MinIO
+s3() {
+  curl -s -f --aws-sigv4 "aws:amz:us-east-1:s3" --user "$MINIO_ROOT_USER:$MINIO_ROOT_PASSWORD" "$@"
+}
+
+# Encrypt a file and upload it under the given object key, refusing empty files
+upload() {
+  local file=$1
+  local key=$2
+  if [ ! -s "$file" ]; then
+    echo "Refusing to upload empty backup $key"
+    return 1
+  fi
+  openssl enc -aes-256-cbc -pbkdf2 -salt -pass env:BACKUP_ENCRYPTION_KEY -in "$file" -out "$file.enc" &&
+    s3 -T "$file.enc" "$MINIO_ADDR/$BUCKET/$key"
+}
+
+# Delete objects under a prefix whose timestamped name is older than the retention cutoff,
+# always keeping the newest KEEP_MIN objects whatever their age
+prune() {
+  local prefix=$1
+  local cutoff
+  cutoff=$(date -u -d @$(( $(date +%s) - RETENTION_DAYS * 86400 )) +%Y%m%d-%H%M%S)
+
+  # Object names embed the timestamp, so a reverse sort lists the newest first
+  for key in $(s3 "$MINIO_ADDR/$BUCKET?list-type=2&prefix=$prefix/" | grep -o '<Key>[^<]*</Key>' | sed 's/<Key>\(.*\)<\/Key>/\1/' | sort -r | tail -n +$((KEEP_MIN + 1))); do
+    stamp=$(echo "$key" | grep -o '[0-9]\{8\}-[0-9]\{6\}')
+    if [ -n "$stamp" ] && [[ "$stamp" < "$cutoff" ]]; then
+      s3 -X DELETE "$MINIO_ADDR/$BUCKET/$key" && echo "Pruned $key"
+    fi
+  done
+}
+
+echo "Waiting for Consul to be ready..."
+until curl -s $CONSUL_ADDR/v1/status/leader | grep -q .; do
+  sleep 5
+done
+echo "Consul is ready."
+
+echo "Waiting for MinIO to be ready..."
+until curl -s -f $MINIO_ADDR/minio/health/live > /dev/null; do
+  sleep 5
+done
+echo "MinIO is ready."
+
+# Create the bucket if it does not exist yet
+if ! s3 -o /dev/null "$MINIO_ADDR/$BUCKET"; then
+  s3 -X PUT "$MINIO_ADDR/$BUCKET" || exit 1
+  echo "Bucket $BUCKET created"
+fi
+
+mkdir -p $WORK_DIR
+
+while true; do
+  STAMP=$(date -u +%Y%m%d-%H%M%S)
+  STATUS="success"
+  UPLOADED="[]"
+  echo "Starting backup $STAMP..."
+
+  # Consul snapshot (catalog, KV, ACLs, sessions)
+  if curl -s -f $CONSUL_ADDR/v1/snapshot -o $WORK_DIR/consul.snap &&
+    upload $WORK_DIR/consul.snap "consul/consul-snapshot-$STAMP.snap.enc"; then
+    UPLOADED=$(echo "$UPLOADED" | jq -c ". + [\"consul/consul-snapshot-$STAMP.snap.enc\"]")
+    echo "Consul snapshot backed up successfully"
+  else
+    STATUS="failed"
+    echo "Consul snapshot backup failed"
+  fi
+
+  # Consul KV export in the format used by consul kv export/import
+  # Fetched to a file first so a failed request is not hidden by the pipe into jq
+  if curl -s -f "$CONSUL_ADDR/v1/kv/?recurse" -o $WORK_DIR/consul-kv-raw.json &&
+    jq '[.[] | {key: .Key, flags: .Flags, value: (.Value // "")}]' $WORK_DIR/consul-kv-raw.json > $WORK_DIR/consul-kv.json &&
+    upload $WORK_DIR/consul-kv.json "consul-kv/consul-kv-$STAMP.json.enc"; then
+    UPLOADED=$(echo "$UPLOADED" | jq -c ". + [\"consul-kv/consul-kv-$STAMP.json.enc\"]")
+    echo "Consul KV export backed up successfully"
+  else
+    STATUS="failed"
+    echo "Consul KV export backup failed"
+  fi
+
+  # Vault raft snapshot, only when a Vault address and token are configured
+  if [ -n "$VAULT_ADDR" ] && [ -n "$VAULT_TOKEN" ]; then
+    if curl -s -f -H "X-Vault-Token: $VAULT_TOKEN" $VAULT_ADDR/v1/sys/storage/raft/snapshot -o $WORK_DIR/vault.snap &&
+      upload $WORK_DIR/vault.snap "vault/vault-snapshot-$STAMP.snap.enc"; then
+      UPLOADED=$(echo "$UPLOADED" | jq -c ". + [\"vault/vault-snapshot-$STAMP.snap.enc\"]")
+      echo "Vault snapshot backed up successfully"
+    else
+      STATUS="failed"
+      echo "Vault snapshot backup failed"
+    fi
+  fi
+
+  rm -f $WORK_DIR/*
+
+  # Only prune after a fully successful run, so repeated failures never delete the last good backups
+  if [ "$STATUS" = "success" ]; then
+    prune consul
+    prune consul-kv
+    prune vault
+  fi
+
+  # Publish the result so backup status can be read from Consul KV
+  curl -s -X PUT -d '{
+    "timestamp": "'"$STAMP"'",
+    "status": "'"$STATUS"'",
+    "objects": '"$UPLOADED"'
+  }' $CONSUL_ADDR/v1/kv/backups/status > /dev/null
+  if [ "$STATUS" = "success" ]; then
+    curl -s -X PUT -d "$STAMP" $CONSUL_ADDR/v1/kv/backups/last-success > /dev/null
+  fi
+
+  echo "Backup $STAMP finished with status $STATUS"
+  sleep $INTERVAL
+done
@@ -0,0 +1,68 @@
+#!/bin/bash
+
+# Script to restore a backup taken by backup-to-minio.sh
+# Usage: ./restore-from-minio.sh <object-key>
+# Example: ./restore-from-minio.sh consul/consul-snapshot-20240101-020000.snap.enc
+
+CONSUL_ADDR=${CONSUL_HTTP_ADDR:-http://consul-server:8500}
+MINIO_ADDR=${BACKUP_MINIO_ENDPOINT:-http://minio:9000}
+BUCKET=${BACKUP_BUCKET:-backups}
+WORK_DIR=/tmp/restore
+
+if [ "$#" -ne 1 ]; then
+  echo "Usage: $0 <object-key>"
+  echo "Available backups:"
+  curl -s -f --aws-sigv4 "aws:amz:us-east-1:s3" --user "$MINIO_ROOT_USER:$MINIO_ROOT_PASSWORD" \
+    "$MINIO_ADDR/$BUCKET?list-type=2" | grep -o '<Key>[^<]*</Key>' | sed 's/<Key>\(.*\)<\/Key>/  \1/'
+  exit 1
+fi
+
+KEY=$1
+mkdir -p $WORK_DIR
+# Never leave decrypted snapshots behind, even when the restore fails
+trap 'rm -rf "$WORK_DIR"' EXIT
+FILE=$WORK_DIR/$(basename "$KEY" .enc)
+
+echo "Downloading $KEY..."
+if ! curl -s -f --aws-sigv4 "aws:amz:us-east-1:s3" --user "$MINIO_ROOT_USER:$MINIO_ROOT_PASSWORD" \
+  "$MINIO_ADDR/$BUCKET/$KEY" -o "$FILE.enc"; then
+  echo "Could not download $KEY from $BUCKET"
+  exit 1
+fi
+
+if ! openssl enc -d -aes-256-cbc -pbkdf2 -pass env:BACKUP_ENCRYPTION_KEY -in "$FILE.enc" -out "$FILE"; then
+  echo "Could not decrypt $KEY, check BACKUP_ENCRYPTION_KEY"
+  exit 1
+fi
+
+case "$KEY" in
+  consul/*)
+    echo "Restoring Consul snapshot..."
+    curl -s -f -X PUT --data-binary @"$FILE" $CONSUL_ADDR/v1/snapshot || exit 1
+    ;;
+  consul-kv/*)
+    echo "Restoring Consul KV entries..."
+    # Transactions are limited to 64 operations, so write the entries in batches
+    TOTAL=$(jq 'length' "$FILE")
+    for ((i = 0; i < TOTAL; i += 64)); do
+      jq "[.[$i:$((i + 64))][] | {KV: {Verb: \"set\", Key: .key, Flags: .flags, Value: .value}}]" "$FILE" |
+        curl -s -f -X PUT -d @- $CONSUL_ADDR/v1/txn > /dev/null || exit 1
+    done
+    echo "$TOTAL keys restored"
+    ;;
+  vault/*)
+    if [ -z "$VAULT_ADDR" ] || [ -z "$VAULT_TOKEN" ]; then
+      echo "VAULT_ADDR and VAULT_TOKEN must be set to restore a Vault snapshot"
+      exit 1
+    fi
+    echo "Restoring Vault snapshot..."
+    curl -s -f -X POST -H "X-Vault-Token: $VAULT_TOKEN" --data-binary @"$FILE" \
+      $VAULT_ADDR/v1/sys/storage/raft/snapshot || exit 1
+    ;;
+  *)
+    echo "Unknown backup type for $KEY"
+    exit 1
+    ;;
+esac
+
+echo "$KEY restored successfully"
@@ -9,6 +9,27 @@ until curl -s http://consul-server:8500/v1/status/leader | grep -q .; do
 done
 echo "Consul is ready."
 
+# Traefik's KV provider reads one key per setting, so each middleware is written as leaf keys.
+# The middleware's tree is replaced in a single transaction, which also clears settings from earlier runs.
+# Usage: register_middleware <name> <key>=<value>...
+register_middleware() {
+  local name=$1
+  shift
+
+  local ops
+  ops=$(jq -n --arg prefix "traefik/http/middlewares/$name" '
+    [{KV: {Verb: "delete-tree", Key: ($prefix + "/")}}]
+    + ($ARGS.positional | map(
+      (index("=")) as $i
+      | {KV: {Verb: "set", Key: ($prefix + "/" + .[:$i]), Value: (.[$i + 1:] | @base64)}}
+    ))' --args "$@")
+
+  if ! curl -s -f -X PUT -d "$ops" http://consul-server:8500/v1/txn > /dev/null; then
+    echo "Failed to register $name middleware"
+    return 1
+  fi
+}
+
 # Rate limiting middleware
 echo "Registering rate-limit middleware..."
 AVERAGE=${TRAEFIK_RATE_LIMIT_AVERAGE:-100}
@@ -23,6 +44,63 @@ curl -X PUT -d '{
 
 echo "Rate limit middleware registered successfully"
 
+# Per-identity rate limiting middlewares, with counters shared by all Traefik instances through Redis
+REDIS_ENDPOINT=${TRAEFIK_RATE_LIMIT_REDIS_ENDPOINT:-redis:6379}
+
+echo "Registering rate-limit-user middleware..."
+USER_AVERAGE=${TRAEFIK_USER_RATE_LIMIT_AVERAGE:-50}
+USER_BURST=${TRAEFIK_USER_RATE_LIMIT_BURST:-25}
+USER_HEADER=${TRAEFIK_USER_RATE_LIMIT_HEADER:-X-User-Id}
+
+register_middleware rate-limit-user \
+  "rateLimit/average=$USER_AVERAGE" \
+  "rateLimit/burst=$USER_BURST" \
+  "rateLimit/sourceCriterion/requestHeaderName=$USER_HEADER" \
+  "rateLimit/redis/endpoints/0=$REDIS_ENDPOINT" \
+  "rateLimit/redis/password=$REDIS_PASSWORD" &&
+  echo "User rate limit middleware registered successfully"
+
+echo "Registering rate-limit-tenant middleware..."
+TENANT_AVERAGE=${TRAEFIK_TENANT_RATE_LIMIT_AVERAGE:-500}
+TENANT_BURST=${TRAEFIK_TENANT_RATE_LIMIT_BURST:-250}
+TENANT_HEADER=${TRAEFIK_TENANT_RATE_LIMIT_HEADER:-X-Tenant-Id}
+
+register_middleware rate-limit-tenant \
+  "rateLimit/average=$TENANT_AVERAGE" \
+  "rateLimit/burst=$TENANT_BURST" \
+  "rateLimit/sourceCriterion/requestHeaderName=$TENANT_HEADER" \
+  "rateLimit/redis/endpoints/0=$REDIS_ENDPOINT" \
+  "rateLimit/redis/password=$REDIS_PASSWORD" &&
+  echo "Tenant rate limit middleware registered successfully"
+
+# Load shedding middleware (caps concurrent requests per router)
+echo "Registering load-shed middleware..."
+MAX_IN_FLIGHT=${TRAEFIK_LOAD_SHED_MAX_IN_FLIGHT:-200}
+
+# Overwrite the limiter key with a constant so clients cannot spread requests over several buckets
+register_middleware load-shed-key \
+  "headers/customRequestHeaders/X-Load-Shed-Key=router" &&
+  register_middleware load-shed-limit \
+    "inFlightReq/amount=$MAX_IN_FLIGHT" \
+    "inFlightReq/sourceCriterion/requestHeaderName=X-Load-Shed-Key" &&
+  register_middleware load-shed \
+    "chain/middlewares/0=load-shed-key" \
+    "chain/middlewares/1=load-shed-limit" &&
+  echo "Load shedding middleware registered successfully"
+
+# Circuit breaker middleware
+echo "Registering circuit-breaker middleware..."
+CB_EXPRESSION=${TRAEFIK_CIRCUIT_BREAKER_EXPRESSION:-"NetworkErrorRatio() > 0.30 || ResponseCodeRatio(500, 600, 0, 600) > 0.25"}
+CB_FALLBACK=${TRAEFIK_CIRCUIT_BREAKER_FALLBACK_DURATION:-10s}
+CB_RECOVERY=${TRAEFIK_CIRCUIT_BREAKER_RECOVERY_DURATION:-10s}
+
+register_middleware circuit-breaker \
+  "circuitBreaker/expression=$CB_EXPRESSION" \
+  "circuitBreaker/checkPeriod=100ms" \
+  "circuitBreaker/fallbackDuration=$CB_FALLBACK" \
+  "circuitBreaker/recoveryDuration=$CB_RECOVERY" &&
+  echo "Circuit breaker middleware registered successfully"
+
 # Secure headers middleware
 echo "Registering secure-headers middleware..."
 curl -X PUT -d '{
@@ -49,6 +127,27 @@ curl -X PUT -d '{
 
 echo "Compression middleware registered successfully"
 
+# Response header stripping middleware
+echo "Registering strip-server-headers middleware..."
+# An empty value tells Traefik to remove the header
+register_middleware strip-server-headers \
+  "headers/customResponseHeaders/Server=" \
+  "headers/customResponseHeaders/X-Powered-By=" &&
+  echo "Strip server headers middleware registered successfully"
+
+# gRPC-Web middleware
+echo "Registering grpc-web middleware..."
+
+# Each origin is its own indexed key (read into an array so "*" is not glob-expanded)
+IFS=',' read -ra ORIGINS <<< "${TRAEFIK_GRPC_WEB_ALLOW_ORIGINS:-*}"
+ORIGIN_KEYS=()
+for n in "${!ORIGINS[@]}"; do
+  ORIGIN_KEYS+=("grpcWeb/allowOrigins/$n=${ORIGINS[$n]}")
+done
+
+register_middleware grpc-web "${ORIGIN_KEYS[@]}" &&
+  echo "gRPC-Web middleware registered successfully"
+
 # IP whitelist middleware
 if [ "${TRAEFIK_IP_WHITELIST_ENABLED:-false}" = "true" ]; then
   echo "Registering ipwhitelist middleware..."
@@ -71,4 +170,22 @@ if [ "${TRAEFIK_IP_WHITELIST_ENABLED:-false}" = "true" ]; then
   echo "IP whitelist middleware registered successfully"
 fi
 
+# Forward auth middleware (edge token verification)
+if [ "${TRAEFIK_FORWARD_AUTH_ENABLED:-false}" = "true" ]; then
+  echo "Registering jwt-auth middleware..."
+
+  # Each forwarded header is its own indexed key under authResponseHeaders
+  IFS=',' read -ra HEADERS <<< "${TRAEFIK_FORWARD_AUTH_RESPONSE_HEADERS:-X-User-Id,X-User-Roles,X-Tenant-Id,X-Identity-Timestamp,X-Identity-Signature}"
+  HEADER_KEYS=()
+  for n in "${!HEADERS[@]}"; do
+    HEADER_KEYS+=("forwardAuth/authResponseHeaders/$n=${HEADERS[$n]}")
+  done
+
+  register_middleware jwt-auth \
+    "forwardAuth/address=$TRAEFIK_FORWARD_AUTH_ADDRESS" \
+    "forwardAuth/trustForwardHeader=false" \
+    "${HEADER_KEYS[@]}" &&
+    echo "JWT auth middleware registered successfully"
+fi
+
 echo "Traefik configuration has been successfully registered in Consul."
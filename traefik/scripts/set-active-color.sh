@@ -0,0 +1,77 @@
+#!/bin/bash
+
+# Script to switch a blue/green deployment by pointing a Traefik service stored in Consul at one color
+# Usage: ./set-active-color.sh <name> <blue|green>
+# Example: ./set-active-color.sh orders green
+#
+# Each color is registered in Consul as its own service, <name>-blue and <name>-green, tagged traefik.enable=true.
+# The switch is a single Consul transaction, so Traefik moves all new requests at once.
+# After DRAIN_SECONDS, instances of the inactive color are put into Consul maintenance mode.
+
+CONSUL_ADDR=${CONSUL_HTTP_ADDR:-http://localhost:8500}
+DRAIN_SECONDS=${DRAIN_SECONDS:-30}
+
+if [ "$#" -ne 2 ]; then
+  echo "Usage: $0 <name> <blue|green>"
+  exit 1
+fi
+
+NAME=$1
+COLOR=$2
+
+case "$COLOR" in
+  blue) INACTIVE=green ;;
+  green) INACTIVE=blue ;;
+  *)
+    echo "Color must be blue or green"
+    exit 1
+    ;;
+esac
+
+# Instances of the new color may still be in maintenance from an earlier switch
+for id in $(curl -s "$CONSUL_ADDR/v1/catalog/service/$NAME-$COLOR" | jq -r '.[].ServiceID'); do
+  curl -s -X PUT "$CONSUL_ADDR/v1/agent/service/maintenance/$id?enable=false" > /dev/null
+done
+
+# Refuse to switch to a color without passing instances
+PASSING=$(curl -s "$CONSUL_ADDR/v1/health/service/$NAME-$COLOR?passing" | jq 'length')
+if [ -z "$PASSING" ] || [ "$PASSING" -eq 0 ]; then
+  echo "No passing instances of $NAME-$COLOR registered in Consul, aborting"
+  exit 1
+fi
+
+echo "Switching $NAME to $COLOR ($PASSING passing instances)..."
+
+# Traefik's KV provider reads one key per setting. The service tree is replaced and the active color
+# recorded in a single transaction, so Traefik never sees a half-written service.
+PREFIX=traefik/http/services/$NAME
+OPS=$(jq -n \
+  --arg prefix "$PREFIX" \
+  --arg service "$NAME-$COLOR@consulcatalog" \
+  --arg color "$COLOR" \
+  --arg color_key "deployments/$NAME/active-color" \
+  '[
+    {KV: {Verb: "delete-tree", Key: ($prefix + "/")}},
+    {KV: {Verb: "set", Key: ($prefix + "/weighted/services/0/name"), Value: ($service | @base64)}},
+    {KV: {Verb: "set", Key: ($prefix + "/weighted/services/0/weight"), Value: ("1" | @base64)}},
+    {KV: {Verb: "set", Key: $color_key, Value: ($color | @base64)}}
+  ]')
+
+# Never drain the old color unless traffic has actually moved away from it
+curl -s -f -X PUT -d "$OPS" $CONSUL_ADDR/v1/txn > /dev/null || {
+  echo "Failed to switch $NAME to $COLOR in Consul, leaving $NAME-$INACTIVE in service"
+  exit 1
+}
+
+echo "$NAME is now served by $COLOR"
+
+# Drain the inactive color once in-flight requests had time to complete
+echo "Draining $NAME-$INACTIVE in $DRAIN_SECONDS seconds..."
+sleep $DRAIN_SECONDS
+
+for id in $(curl -s "$CONSUL_ADDR/v1/catalog/service/$NAME-$INACTIVE" | jq -r '.[].ServiceID'); do
+  curl -s -X PUT "$CONSUL_ADDR/v1/agent/service/maintenance/$id?enable=true&reason=inactive+color" > /dev/null
+  echo "Instance $id put into maintenance mode"
+done
+
+echo "Blue/green switch for $NAME completed successfully"
@@ -0,0 +1,55 @@
+#!/bin/bash
+
+# Script to split traffic between two versions of a service through a Traefik weighted service stored in Consul
+# Usage: ./set-traffic-split.sh <name> <stable-service> <canary-service> <canary-weight> [sticky-cookie]
+# Example: ./set-traffic-split.sh orders orders-v1@consulcatalog orders-v2@consulcatalog 10 orders_canary
+
+CONSUL_ADDR=${CONSUL_HTTP_ADDR:-http://localhost:8500}
+
+if [ "$#" -lt 4 ]; then
+  echo "Usage: $0 <name> <stable-service> <canary-service> <canary-weight> [sticky-cookie]"
+  exit 1
+fi
+
+NAME=$1
+STABLE=$2
+CANARY=$3
+CANARY_WEIGHT=$4
+STICKY_COOKIE=$5
+
+if ! [[ "$CANARY_WEIGHT" =~ ^[0-9]+$ ]] || [ "$CANARY_WEIGHT" -gt 100 ]; then
+  echo "Canary weight must be an integer between 0 and 100"
+  exit 1
+fi
+STABLE_WEIGHT=$((100 - CANARY_WEIGHT))
+
+# Traefik's KV provider reads one key per setting, so the weighted service is written as leaf keys.
+# Replacing the whole tree in one transaction also removes settings left over from a previous split.
+PREFIX=traefik/http/services/$NAME
+OPS=$(jq -n \
+  --arg prefix "$PREFIX" \
+  --arg stable "$STABLE" \
+  --arg stable_weight "$STABLE_WEIGHT" \
+  --arg canary "$CANARY" \
+  --arg canary_weight "$CANARY_WEIGHT" \
+  --arg cookie "$STICKY_COOKIE" \
+  '[
+    {KV: {Verb: "delete-tree", Key: ($prefix + "/")}},
+    {KV: {Verb: "set", Key: ($prefix + "/weighted/services/0/name"), Value: ($stable | @base64)}},
+    {KV: {Verb: "set", Key: ($prefix + "/weighted/services/0/weight"), Value: ($stable_weight | @base64)}},
+    {KV: {Verb: "set", Key: ($prefix + "/weighted/services/1/name"), Value: ($canary | @base64)}},
+    {KV: {Verb: "set", Key: ($prefix + "/weighted/services/1/weight"), Value: ($canary_weight | @base64)}}
+  ]
+  # Sticky sessions keep a client on the version it was first assigned to
+  + if $cookie == "" then [] else [
+    {KV: {Verb: "set", Key: ($prefix + "/weighted/sticky/cookie/name"), Value: ($cookie | @base64)}},
+    {KV: {Verb: "set", Key: ($prefix + "/weighted/sticky/cookie/httpOnly"), Value: ("true" | @base64)}}
+  ] end')
+
+echo "Routing $STABLE_WEIGHT% of $NAME traffic to $STABLE and $CANARY_WEIGHT% to $CANARY..."
+curl -s -f -X PUT -d "$OPS" $CONSUL_ADDR/v1/txn > /dev/null || {
+  echo "Failed to write traffic split for $NAME to Consul"
+  exit 1
+}
+
+echo "Traffic split for $NAME registered successfully"